@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/caarlos0/env/parsers"
 )
@@ -17,9 +18,6 @@ var (
 	// ErrNotAStructPtr is returned if you pass something that is not a pointer to a
 	// Struct to Parse
 	ErrNotAStructPtr = errors.New("env: expected a pointer to a Struct")
-	// OnEnvVarSet is an optional convenience callback, such as for logging purposes.
-	// If not nil, it's called after successfully setting the given field from the given value.
-	OnEnvVarSet func(reflect.StructField, string)
 
 	defaultBuiltInParsers = map[reflect.Kind]ParserFunc{
 		reflect.Bool: func(v string) (interface{}, error) {
@@ -90,15 +88,58 @@ type CustomParsers map[reflect.Type]ParserFunc
 // ParserFunc defines the signature of a function that can be used within `CustomParsers`
 type ParserFunc func(v string) (interface{}, error)
 
+// Options allows callers of ParseWithOptions to customize how values are
+// looked up and applied, without relying on package-level state.
+type Options struct {
+	// Environment, when non-nil, is consulted instead of the process
+	// environment. This lets tests and library consumers parse hermetically
+	// and run in parallel without touching global state. Ignored if Source
+	// is set.
+	Environment map[string]string
+	// Source, when non-nil, takes priority over Environment and the process
+	// environment. It allows layering multiple backing stores, e.g. a
+	// dotenv file as a fallback for the process environment; see
+	// LayeredSource, OSSource, MapSource and DotEnvSource.
+	Source Source
+	// Prefix is prepended to every `env` tag key, including keys resolved
+	// inside nested structs.
+	Prefix string
+	// FuncMap holds additional parsers, keyed by the type they handle.
+	FuncMap CustomParsers
+	// OnSet, if non-nil, is called after a field has been successfully set,
+	// receiving the struct field, its new value, and the raw string it was
+	// parsed from.
+	OnSet func(reflect.StructField, interface{}, string)
+	// RequiredIfNoDef marks every field that has no `envDefault` tag as
+	// required, without needing a `required` tag option on each one.
+	RequiredIfNoDef bool
+	// UseFieldNames makes fields without an `env` tag derive their key from
+	// the field name converted to SCREAMING_SNAKE_CASE (e.g. DBHost becomes
+	// DB_HOST), composed with any active Prefix / envPrefix. Unexported
+	// fields are never considered.
+	UseFieldNames bool
+	// FailFast makes ParseWithOptions return as soon as the first field
+	// fails, instead of collecting every failure into an AggregateError.
+	FailFast bool
+}
+
 // Parse parses a struct containing `env` tags and loads its values from
 // environment variables.
 func Parse(v interface{}) error {
-	return ParseWithFuncs(v, CustomParsers{})
+	return ParseWithOptions(v, Options{})
 }
 
 // ParseWithFuncs is the same as `Parse` except it also allows the user to pass
 // in custom parsers.
 func ParseWithFuncs(v interface{}, funcMap CustomParsers) error {
+	return ParseWithOptions(v, Options{FuncMap: funcMap})
+}
+
+// ParseWithOptions is the same as `Parse` except it also allows the user to
+// customize the lookup source, a key prefix, custom parsers, a set callback
+// and whether fields without a default are implicitly required. See Options
+// for details.
+func ParseWithOptions(v interface{}, opts Options) error {
 	ptrRef := reflect.ValueOf(v)
 	if ptrRef.Kind() != reflect.Ptr {
 		return ErrNotAStructPtr
@@ -108,79 +149,205 @@ func ParseWithFuncs(v interface{}, funcMap CustomParsers) error {
 		return ErrNotAStructPtr
 	}
 	var parsers = defaultCustomParsers()
-	for k, v := range funcMap {
+	for k, v := range opts.FuncMap {
 		parsers[k] = v
 	}
-	return doParse(ref, parsers)
+	opts.FuncMap = parsers
+	return doParse(ref, opts)
 }
 
-func doParse(ref reflect.Value, funcMap CustomParsers) error {
+func doParse(ref reflect.Value, opts Options) error {
 	refType := ref.Type()
+	var errs []error
+
+	collect := func(err error) error {
+		if opts.FailFast {
+			return err
+		}
+		errs = append(errs, unwrapAggregate(err)...)
+		return nil
+	}
 
 	for i := 0; i < refType.NumField(); i++ {
 		refField := ref.Field(i)
+		refTypeField := refType.Field(i)
+
+		// envPrefix scopes every key resolved inside a nested struct, and
+		// composes through arbitrary nesting depth.
+		childOpts := opts
+		if prefix := refTypeField.Tag.Get("envPrefix"); prefix != "" {
+			childOpts.Prefix = opts.Prefix + prefix
+		}
+
 		if reflect.Ptr == refField.Kind() && !refField.IsNil() && refField.CanSet() {
-			err := Parse(refField.Interface())
-			if nil != err {
-				return err
+			if err := ParseWithOptions(refField.Interface(), childOpts); err != nil {
+				if err := collect(err); err != nil {
+					return err
+				}
 			}
 			continue
 		}
-		refTypeField := refType.Field(i)
-		value, err := get(refTypeField)
+		value, key, unset, err := get(refTypeField, opts)
 		if err != nil {
-			return err
+			if err := collect(err); err != nil {
+				return err
+			}
+			continue
 		}
 		if value == "" {
 			if reflect.Struct == refField.Kind() {
-				if err := doParse(refField, funcMap); err != nil {
-					return err
+				if err := doParse(refField, childOpts); err != nil {
+					if err := collect(err); err != nil {
+						return err
+					}
 				}
 			}
 			continue
 		}
-		if err := set(refField, refTypeField, value, funcMap); err != nil {
-			return err
+		if err := set(refField, refTypeField, value, opts.FuncMap, key); err != nil {
+			if err := collect(err); err != nil {
+				return err
+			}
+			continue
+		}
+		// Only unset the source env var once the value has actually been
+		// parsed and applied, so a transient parse failure doesn't destroy
+		// the only copy of a secret.
+		if unset {
+			os.Unsetenv(key)
 		}
-		// TODO: change this to a param instead of global
-		if OnEnvVarSet != nil {
-			OnEnvVarSet(refTypeField, value)
+		if opts.OnSet != nil {
+			opts.OnSet(refTypeField, refField.Interface(), value)
 		}
 	}
+	if len(errs) > 0 {
+		return &AggregateError{errors: errs}
+	}
 	return nil
 }
 
-func get(field reflect.StructField) (string, error) {
-	var (
-		val string
-		err error
-	)
+// AggregateError is returned by ParseWithOptions when one or more fields
+// fail, so that callers can see every problem in their environment at once
+// instead of fixing it one variable at a time. It implements Unwrap() []error
+// so errors.Is / errors.As fan out across all of them.
+type AggregateError struct {
+	errors []error
+}
+
+func (e *AggregateError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("env:")
+	for _, err := range e.errors {
+		sb.WriteString("\n    - ")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the individual errors collected into e.
+func (e *AggregateError) Unwrap() []error {
+	return e.errors
+}
+
+// unwrapAggregate flattens err into its constituent errors if it's an
+// *AggregateError, so that nested doParse calls don't produce an
+// AggregateError of AggregateErrors.
+func unwrapAggregate(err error) []error {
+	var agg *AggregateError
+	if errors.As(err, &agg) {
+		return agg.errors
+	}
+	return []error{err}
+}
 
-	key, opts := parseKeyForOption(field.Tag.Get("env"))
+// get resolves field's value from opts. It returns the raw string value, the
+// fully-qualified key it was resolved from, and whether that key should be
+// unset from the process environment once the caller has successfully
+// applied the value to the struct field.
+func get(field reflect.StructField, opts Options) (val string, key string, unset bool, err error) {
+	key, tagOpts := parseKeyForOption(field.Tag.Get("env"))
+	if key == "" && opts.UseFieldNames && field.PkgPath == "" && !isStructKind(field.Type) {
+		key = toScreamingSnakeCase(field.Name)
+	}
+	key = opts.Prefix + key
 
 	defaultValue := field.Tag.Get("envDefault")
-	val = getOr(key, defaultValue)
+	usedDefault := false
+	if envValue, ok := lookup(key, opts); ok {
+		val = envValue
+	} else {
+		val = defaultValue
+		usedDefault = true
+	}
 
 	expandVar := field.Tag.Get("envExpand")
 	if strings.ToLower(expandVar) == "true" {
-		val = os.ExpandEnv(val)
+		val = expand(val, opts)
 	}
 
-	if len(opts) > 0 {
-		for _, opt := range opts {
-			// The only option supported is "required".
+	fromFile := strings.ToLower(field.Tag.Get("envFile")) == "true"
+	required := opts.RequiredIfNoDef && defaultValue == ""
+	unsetAfter := false
+	if len(tagOpts) > 0 {
+		for _, opt := range tagOpts {
 			switch opt {
 			case "":
 				break
 			case "required":
-				val, err = getRequired(key)
+				required = true
+			case "file":
+				fromFile = true
+			case "unset":
+				unsetAfter = true
 			default:
 				err = fmt.Errorf("env: tag option %q not supported", opt)
 			}
 		}
 	}
+	if required {
+		val, err = getRequired(key, opts)
+		usedDefault = false
+	}
+	if err != nil {
+		return "", "", false, err
+	}
 
-	return val, err
+	// A file:// envDefault is only consulted when no env var overrode it;
+	// envFile (or the ",file" option) always treats val as a path, however
+	// it was resolved above. An absent, non-required file-backed field
+	// leaves val empty like any other absent field, instead of trying to
+	// read an empty path.
+	switch {
+	case usedDefault && strings.HasPrefix(val, "file://"):
+		val, err = readFile(field, strings.TrimPrefix(val, "file://"), key)
+	case fromFile && val != "":
+		val, err = readFile(field, val, key)
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+
+	return val, key, unsetAfter && usingProcessEnv(opts), nil
+}
+
+// usingProcessEnv reports whether opts resolves lookups against the real
+// process environment, as opposed to a custom Environment map or Source.
+func usingProcessEnv(opts Options) bool {
+	if opts.Source != nil {
+		_, ok := opts.Source.(OSSource)
+		return ok
+	}
+	return opts.Environment == nil
+}
+
+// readFile reads the trimmed contents of path, to be used as the raw value
+// handed to a field's parser.
+func readFile(field reflect.StructField, path string, key string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", newParseError(key, field, path, fmt.Errorf("could not read file %q: %w", path, err))
+	}
+	return strings.TrimSpace(string(b)), nil
 }
 
 // split the env tag's key into the expected key and desired option, if any.
@@ -189,31 +356,78 @@ func parseKeyForOption(key string) (string, []string) {
 	return opts[0], opts[1:]
 }
 
-func getRequired(key string) (string, error) {
-	if value, ok := os.LookupEnv(key); ok {
-		return value, nil
+// toScreamingSnakeCase converts a Go identifier such as "DBHost" or "APIKey"
+// into its SCREAMING_SNAKE_CASE form ("DB_HOST", "API_KEY"), treating a run
+// of consecutive uppercase letters as a single token until a following
+// lowercase letter starts a new one.
+func toScreamingSnakeCase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToUpper(r))
 	}
-	return "", fmt.Errorf(`env: required environment variable "%q" is not set`, key)
+	return sb.String()
 }
 
-func getOr(key, defaultValue string) string {
-	value, ok := os.LookupEnv(key)
-	if ok {
+// isStructKind reports whether t (or the type it points to) is a struct, so
+// UseFieldNames can skip deriving a key for fields that doParse treats as
+// nested structs to recurse into rather than values to set.
+func isStructKind(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// lookup resolves key against opts.Source when set, then against
+// opts.Environment when set, falling back to the process environment
+// otherwise.
+func lookup(key string, opts Options) (string, bool) {
+	if opts.Source != nil {
+		return opts.Source.Lookup(key)
+	}
+	if opts.Environment != nil {
+		value, ok := opts.Environment[key]
+		return value, ok
+	}
+	return os.LookupEnv(key)
+}
+
+// expand is the Options-aware equivalent of os.ExpandEnv.
+func expand(s string, opts Options) string {
+	return os.Expand(s, func(key string) string {
+		value, _ := lookup(key, opts)
 		return value
+	})
+}
+
+func getRequired(key string, opts Options) (string, error) {
+	if value, ok := lookup(key, opts); ok {
+		return value, nil
 	}
-	return defaultValue
+	return "", fmt.Errorf(`env: required environment variable "%q" is not set`, key)
 }
 
-func set(field reflect.Value, sf reflect.StructField, value string, funcMap CustomParsers) error {
+func set(field reflect.Value, sf reflect.StructField, value string, funcMap CustomParsers, key string) error {
 	if field.Kind() == reflect.Slice {
-		return handleSlice(field, value, sf, funcMap)
+		return handleSlice(field, value, sf, funcMap, key)
+	}
+	if field.Kind() == reflect.Map {
+		return handleMap(field, value, sf, funcMap, key)
 	}
 
 	parserFunc, ok := funcMap[sf.Type]
 	if ok {
 		val, err := parserFunc(value)
 		if err != nil {
-			return newParseError(sf, err)
+			return newParseError(key, sf, value, err)
 		}
 		field.Set(reflect.ValueOf(val))
 		return nil
@@ -223,16 +437,16 @@ func set(field reflect.Value, sf reflect.StructField, value string, funcMap Cust
 	if ok {
 		val, err := parserFunc(value)
 		if err != nil {
-			return newParseError(sf, err)
+			return newParseError(key, sf, value, err)
 		}
 		field.Set(reflect.ValueOf(val).Convert(sf.Type))
 		return nil
 	}
 
-	return handleTextUnmarshaler(field, value, sf)
+	return handleTextUnmarshaler(field, value, sf, key)
 }
 
-func handleSlice(field reflect.Value, value string, sf reflect.StructField, funcMap CustomParsers) error {
+func handleSlice(field reflect.Value, value string, sf reflect.StructField, funcMap CustomParsers, key string) error {
 	var separator = sf.Tag.Get("envSeparator")
 	if separator == "" {
 		separator = ","
@@ -245,36 +459,119 @@ func handleSlice(field reflect.Value, value string, sf reflect.StructField, func
 	}
 
 	if _, ok := reflect.New(elemType).Interface().(encoding.TextUnmarshaler); ok {
-		return parseTextUnmarshalers(field, parts, sf)
+		return parseTextUnmarshalers(field, parts, sf, key)
 	}
 
 	parserFunc, ok := funcMap[elemType]
 	if !ok {
 		parserFunc, ok = defaultBuiltInParsers[elemType.Kind()]
 		if !ok {
-			return newNoParserError(sf)
+			return newNoParserError(key, sf)
 		}
 	}
 
 	var result = reflect.MakeSlice(sf.Type, 0, len(parts))
+	var errs []error
 	for _, part := range parts {
 		r, err := parserFunc(part)
 		if err != nil {
-			return newParseError(sf, err)
+			errs = append(errs, newParseError(key, sf, part, err))
+			continue
 		}
 		var v = reflect.ValueOf(r).Convert(elemType)
 		if sf.Type.Elem().Kind() == reflect.Ptr {
 			// TODO: add this!
-			return fmt.Errorf("env: point slices of built-in and aliased types are not supported: %s %s", sf.Name, sf.Type)
+			errs = append(errs, fmt.Errorf("env: point slices of built-in and aliased types are not supported: %s %s", sf.Name, sf.Type))
+			continue
 		}
 		result = reflect.Append(result, v)
 	}
+	if len(errs) > 0 {
+		return &AggregateError{errors: errs}
+	}
+
+	field.Set(result)
+	return nil
+}
+
+// handleMap is the map analogue of handleSlice: it splits value on
+// envSeparator into "key<envKeyValSeparator>value" entries and parses each
+// side with the appropriate parser (custom parser, then default built-in by
+// kind, then TextUnmarshaler).
+func handleMap(field reflect.Value, value string, sf reflect.StructField, funcMap CustomParsers, key string) error {
+	var separator = sf.Tag.Get("envSeparator")
+	if separator == "" {
+		separator = ","
+	}
+	var kvSeparator = sf.Tag.Get("envKeyValSeparator")
+	if kvSeparator == "" {
+		kvSeparator = ":"
+	}
+
+	keyType := sf.Type.Key()
+	elemType := sf.Type.Elem()
+
+	result := reflect.MakeMap(sf.Type)
+	var errs []error
+	for _, part := range strings.Split(value, separator) {
+		pair := strings.SplitN(part, kvSeparator, 2)
+		if len(pair) != 2 {
+			errs = append(errs, fmt.Errorf("env: invalid map item %q on field %q (env key %q), expected format key%svalue", part, sf.Name, key, kvSeparator))
+			continue
+		}
+
+		k, err := parseMapElem(keyType, pair[0], sf, funcMap, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v, err := parseMapElem(elemType, pair[1], sf, funcMap, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result.SetMapIndex(k, v)
+	}
+	if len(errs) > 0 {
+		return &AggregateError{errors: errs}
+	}
 
 	field.Set(result)
 	return nil
 }
 
-func handleTextUnmarshaler(field reflect.Value, value string, sf reflect.StructField) error {
+// parseMapElem parses raw into t, trying a custom parser, then a built-in
+// one by kind, then falling back to encoding.TextUnmarshaler.
+func parseMapElem(t reflect.Type, raw string, sf reflect.StructField, funcMap CustomParsers, key string) (reflect.Value, error) {
+	if parserFunc, ok := funcMap[t]; ok {
+		val, err := parserFunc(raw)
+		if err != nil {
+			return reflect.Value{}, newParseError(key, sf, raw, err)
+		}
+		return reflect.ValueOf(val).Convert(t), nil
+	}
+
+	if parserFunc, ok := defaultBuiltInParsers[t.Kind()]; ok {
+		val, err := parserFunc(raw)
+		if err != nil {
+			return reflect.Value{}, newParseError(key, sf, raw, err)
+		}
+		return reflect.ValueOf(val).Convert(t), nil
+	}
+
+	if _, ok := reflect.New(t).Interface().(encoding.TextUnmarshaler); ok {
+		pv := reflect.New(t)
+		tm := pv.Interface().(encoding.TextUnmarshaler)
+		if err := tm.UnmarshalText([]byte(raw)); err != nil {
+			return reflect.Value{}, newParseError(key, sf, raw, err)
+		}
+		return pv.Elem(), nil
+	}
+
+	return reflect.Value{}, newNoParserError(key, sf)
+}
+
+func handleTextUnmarshaler(field reflect.Value, value string, sf reflect.StructField, key string) error {
 	if reflect.Ptr == field.Kind() {
 		if field.IsNil() {
 			field.Set(reflect.New(field.Type().Elem()))
@@ -285,13 +582,13 @@ func handleTextUnmarshaler(field reflect.Value, value string, sf reflect.StructF
 
 	tm, ok := field.Interface().(encoding.TextUnmarshaler)
 	if !ok {
-		return newNoParserError(sf)
+		return newNoParserError(key, sf)
 	}
 	var err = tm.UnmarshalText([]byte(value))
-	return newParseError(sf, err)
+	return newParseError(key, sf, value, err)
 }
 
-func parseTextUnmarshalers(field reflect.Value, data []string, sf reflect.StructField) error {
+func parseTextUnmarshalers(field reflect.Value, data []string, sf reflect.StructField, key string) error {
 	s := len(data)
 	elemType := field.Type().Elem()
 	slice := reflect.MakeSlice(reflect.SliceOf(elemType), s, s)
@@ -305,7 +602,7 @@ func parseTextUnmarshalers(field reflect.Value, data []string, sf reflect.Struct
 		}
 		tm := sv.Interface().(encoding.TextUnmarshaler)
 		if err := tm.UnmarshalText([]byte(v)); err != nil {
-			return newParseError(sf, err)
+			return newParseError(key, sf, v, err)
 		}
 		if kind == reflect.Ptr {
 			slice.Index(i).Set(sv)
@@ -317,25 +614,44 @@ func parseTextUnmarshalers(field reflect.Value, data []string, sf reflect.Struct
 	return nil
 }
 
-func newParseError(sf reflect.StructField, err error) error {
+// newParseError builds the error returned when a field's raw value could not
+// be converted to its Go type. The resulting ParseError carries the env key
+// and raw value alongside the struct field, so a caller can tell which entry
+// in an AggregateError to fix without cross-referencing the struct
+// definition.
+func newParseError(key string, sf reflect.StructField, value string, err error) error {
 	if err == nil {
 		return nil
 	}
-	return parseError{
-		sf:  sf,
-		err: err,
+	return ParseError{
+		KeyName:   key,
+		FieldName: sf.Name,
+		TypeName:  sf.Type.String(),
+		Value:     value,
+		Err:       err,
 	}
 }
 
-type parseError struct {
-	sf  reflect.StructField
-	err error
+// ParseError is returned when a field's raw value could not be converted to
+// its Go type.
+type ParseError struct {
+	KeyName   string
+	FieldName string
+	TypeName  string
+	Value     string
+	Err       error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf(`env: parse error on field "%s" of type "%s": could not parse %q (env key %q): %v`, e.FieldName, e.TypeName, e.Value, e.KeyName, e.Err)
 }
 
-func (e parseError) Error() string {
-	return fmt.Sprintf(`env: parse error on field "%s" of type "%s": %v`, e.sf.Name, e.sf.Type, e.err)
+// Unwrap returns the underlying parser error, so errors.Is / errors.As reach
+// it through a ParseError.
+func (e ParseError) Unwrap() error {
+	return e.Err
 }
 
-func newNoParserError(sf reflect.StructField) error {
-	return fmt.Errorf(`env: no parser found for field "%s" of type "%s"`, sf.Name, sf.Type)
+func newNoParserError(key string, sf reflect.StructField) error {
+	return fmt.Errorf(`env: no parser found for field "%s" of type "%s" (env key %q)`, sf.Name, sf.Type, key)
 }
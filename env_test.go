@@ -0,0 +1,556 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type aggregateConfig struct {
+	Port    int    `env:"PORT"`
+	Timeout int    `env:"TIMEOUT"`
+	Host    string `env:"HOST,required"`
+}
+
+func TestAggregateErrorCollectsEveryFieldFailure(t *testing.T) {
+	var cfg aggregateConfig
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{
+			"PORT":    "not-a-number",
+			"TIMEOUT": "also-not-a-number",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	var agg *AggregateError
+	if !errors.As(err, &agg) {
+		t.Fatalf("expected *AggregateError, got %T: %v", err, err)
+	}
+	if len(agg.errors) != 3 {
+		t.Fatalf("expected 3 collected errors (PORT, TIMEOUT, HOST), got %d: %v", len(agg.errors), agg.errors)
+	}
+
+	unwrapped := agg.Unwrap()
+	if len(unwrapped) != 3 {
+		t.Fatalf("expected Unwrap() to expose all 3 errors, got %d", len(unwrapped))
+	}
+}
+
+func TestAggregateErrorEntriesCarryKeyAndValue(t *testing.T) {
+	var cfg aggregateConfig
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{
+			"PORT":    "not-a-number",
+			"TIMEOUT": "5",
+			"HOST":    "localhost",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	var perr ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError among the collected errors, got %T: %v", err, err)
+	}
+	if perr.KeyName != "PORT" {
+		t.Errorf("KeyName = %q, want %q", perr.KeyName, "PORT")
+	}
+	if perr.FieldName != "Port" {
+		t.Errorf("FieldName = %q, want %q", perr.FieldName, "Port")
+	}
+	if perr.TypeName != "int" {
+		t.Errorf("TypeName = %q, want %q", perr.TypeName, "int")
+	}
+	if perr.Value != "not-a-number" {
+		t.Errorf("Value = %q, want %q", perr.Value, "not-a-number")
+	}
+	if perr.Err == nil {
+		t.Error("Err is nil, want the underlying strconv error")
+	}
+	if !strings.Contains(err.Error(), `"PORT"`) {
+		t.Errorf("AggregateError.Error() = %q, want it to mention the PORT key", err.Error())
+	}
+}
+
+type dbConfig struct {
+	Host string `env:"HOST"`
+	Port int    `env:"PORT" envDefault:"5432"`
+}
+
+type poolConfig struct {
+	Size int `env:"SIZE"`
+}
+
+type appConfig struct {
+	DB   dbConfig   `envPrefix:"DB_"`
+	Pool poolConfig `envPrefix:"POOL_"`
+}
+
+type nestedPrefixConfig struct {
+	App appConfig `envPrefix:"APP_"`
+}
+
+func TestEnvPrefixComposesAcrossNesting(t *testing.T) {
+	var cfg nestedPrefixConfig
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{
+			"APP_DB_HOST":   "localhost",
+			"APP_DB_PORT":   "5433",
+			"APP_POOL_SIZE": "10",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.App.DB.Host != "localhost" {
+		t.Errorf("DB.Host = %q, want %q", cfg.App.DB.Host, "localhost")
+	}
+	if cfg.App.DB.Port != 5433 {
+		t.Errorf("DB.Port = %d, want %d", cfg.App.DB.Port, 5433)
+	}
+	if cfg.App.Pool.Size != 10 {
+		t.Errorf("Pool.Size = %d, want %d", cfg.App.Pool.Size, 10)
+	}
+}
+
+func TestEnvPrefixComposesWithGlobalOptionsPrefix(t *testing.T) {
+	var cfg appConfig
+	err := ParseWithOptions(&cfg, Options{
+		Prefix: "MYAPP_",
+		Environment: map[string]string{
+			"MYAPP_DB_HOST": "db.internal",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DB.Host != "db.internal" {
+		t.Errorf("DB.Host = %q, want %q", cfg.DB.Host, "db.internal")
+	}
+}
+
+func TestMapField(t *testing.T) {
+	type config struct {
+		Labels map[string]string `env:"LABELS"`
+		Ports  map[string]int    `env:"PORTS"`
+	}
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{
+			"LABELS": "env:prod,team:core",
+			"PORTS":  "http:80,https:443",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantLabels := map[string]string{"env": "prod", "team": "core"}
+	if len(cfg.Labels) != len(wantLabels) {
+		t.Fatalf("Labels = %v, want %v", cfg.Labels, wantLabels)
+	}
+	for k, v := range wantLabels {
+		if cfg.Labels[k] != v {
+			t.Errorf("Labels[%q] = %q, want %q", k, cfg.Labels[k], v)
+		}
+	}
+
+	wantPorts := map[string]int{"http": 80, "https": 443}
+	for k, v := range wantPorts {
+		if cfg.Ports[k] != v {
+			t.Errorf("Ports[%q] = %d, want %d", k, cfg.Ports[k], v)
+		}
+	}
+}
+
+func TestMapFieldCustomSeparators(t *testing.T) {
+	type config struct {
+		Labels map[string]string `env:"LABELS" envSeparator:";" envKeyValSeparator:"="`
+	}
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{"LABELS": "env=prod;team=core"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Labels["env"] != "prod" || cfg.Labels["team"] != "core" {
+		t.Errorf("Labels = %v, want env=prod and team=core", cfg.Labels)
+	}
+}
+
+func TestMapFieldInvalidInput(t *testing.T) {
+	type config struct {
+		Ports map[string]int `env:"PORTS"`
+	}
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{"PORTS": "http:not-a-number"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a non-numeric map value, got nil")
+	}
+
+	err = ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{"PORTS": "http-80"},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a malformed key:val pair, got nil")
+	}
+}
+
+func TestEnvFileTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type config struct {
+		Password string `env:"PASSWORD_FILE" envFile:"true"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{Environment: map[string]string{"PASSWORD_FILE": path}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Password != "s3cr3t" {
+		t.Errorf("Password = %q, want %q", cfg.Password, "s3cr3t")
+	}
+}
+
+func TestEnvFileCommaOption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cr3t"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type config struct {
+		Password string `env:"PASSWORD_FILE,file"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{Environment: map[string]string{"PASSWORD_FILE": path}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Password != "s3cr3t" {
+		t.Errorf("Password = %q, want %q", cfg.Password, "s3cr3t")
+	}
+}
+
+func TestEnvDefaultFileScheme(t *testing.T) {
+	type config struct {
+		Password string `env:"PASSWORD" envDefault:"file://testdata/default-secret"`
+	}
+	var cfg config
+	if err := ParseWithOptions(&cfg, Options{Environment: map[string]string{}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Password != "default-secret" {
+		t.Errorf("Password = %q, want %q", cfg.Password, "default-secret")
+	}
+
+	// An env var present on the lookup source overrides the file:// default
+	// entirely; it is not itself treated as a path.
+	var overridden config
+	err := ParseWithOptions(&overridden, Options{Environment: map[string]string{"PASSWORD": "from-env"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if overridden.Password != "from-env" {
+		t.Errorf("Password = %q, want %q", overridden.Password, "from-env")
+	}
+}
+
+func TestEnvFileAbsentOptionalFieldIsZeroValue(t *testing.T) {
+	type config struct {
+		Password string `env:"MISSING_PASSWORD_FILE,file"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{Environment: map[string]string{}})
+	if err != nil {
+		t.Fatalf("expected an absent optional file-backed field to be a no-op, got error: %v", err)
+	}
+	if cfg.Password != "" {
+		t.Errorf("Password = %q, want empty", cfg.Password)
+	}
+}
+
+func TestEnvFileMissingPathErrors(t *testing.T) {
+	type config struct {
+		Password string `env:"PASSWORD_FILE" envFile:"true"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{Environment: map[string]string{"PASSWORD_FILE": "/no/such/file"}})
+	if err == nil {
+		t.Fatal("expected an error when the referenced file does not exist")
+	}
+}
+
+func TestToScreamingSnakeCase(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Host", "HOST"},
+		{"DBHost", "DB_HOST"},
+		{"APIKey", "API_KEY"},
+		{"UserID", "USER_ID"},
+		{"ID", "ID"},
+		{"simple", "SIMPLE"},
+		{"AlreadyCamel", "ALREADY_CAMEL"},
+		{"HTTPSProxy", "HTTPS_PROXY"},
+	}
+	for _, tt := range tests {
+		if got := toScreamingSnakeCase(tt.in); got != tt.want {
+			t.Errorf("toScreamingSnakeCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUseFieldNamesDerivesKeys(t *testing.T) {
+	type config struct {
+		DBHost string
+		APIKey string
+		Tagged string `env:"EXPLICIT_KEY"`
+		plain  string
+	}
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		UseFieldNames: true,
+		Environment: map[string]string{
+			"DB_HOST":      "localhost",
+			"API_KEY":      "xyz",
+			"EXPLICIT_KEY": "explicit",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DBHost != "localhost" {
+		t.Errorf("DBHost = %q, want %q", cfg.DBHost, "localhost")
+	}
+	if cfg.APIKey != "xyz" {
+		t.Errorf("APIKey = %q, want %q", cfg.APIKey, "xyz")
+	}
+	if cfg.Tagged != "explicit" {
+		t.Errorf("Tagged = %q, want %q", cfg.Tagged, "explicit")
+	}
+	if cfg.plain != "" {
+		t.Errorf("unexported field plain = %q, want untouched empty value", cfg.plain)
+	}
+}
+
+func TestUseFieldNamesSkipsNestedStructFields(t *testing.T) {
+	type nested struct {
+		DB appConfig `envPrefix:"DB_"`
+	}
+
+	var cfg nested
+	err := ParseWithOptions(&cfg, Options{
+		UseFieldNames: true,
+		Environment: map[string]string{
+			// DB would collide with the derived key for the DB struct field
+			// itself; it must not stop doParse from recursing into it.
+			"DB":           "oops",
+			"DB_DB_HOST":   "localhost",
+			"DB_POOL_SIZE": "5",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DB.DB.Host != "localhost" {
+		t.Errorf("DB.DB.Host = %q, want %q", cfg.DB.DB.Host, "localhost")
+	}
+	if cfg.DB.Pool.Size != 5 {
+		t.Errorf("DB.Pool.Size = %d, want %d", cfg.DB.Pool.Size, 5)
+	}
+}
+
+func TestUnsetOptionClearsProcessEnvAfterSuccess(t *testing.T) {
+	t.Setenv("API_TOKEN", "secret")
+
+	type config struct {
+		Token string `env:"API_TOKEN,required,unset"`
+	}
+	var cfg config
+	if err := Parse(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Token != "secret" {
+		t.Errorf("Token = %q, want %q", cfg.Token, "secret")
+	}
+	if _, ok := os.LookupEnv("API_TOKEN"); ok {
+		t.Error("API_TOKEN should have been unset after a successful parse")
+	}
+}
+
+func TestUnsetOptionLeavesVarOnParseFailure(t *testing.T) {
+	t.Setenv("PORT", "not-a-number")
+
+	type config struct {
+		Port int `env:"PORT,required,unset"`
+	}
+	var cfg config
+	if err := Parse(&cfg); err == nil {
+		t.Fatal("expected a parse error for a non-numeric PORT")
+	}
+	if _, ok := os.LookupEnv("PORT"); !ok {
+		t.Error("PORT should still be set after a failed parse, unset only fires on success")
+	}
+}
+
+func TestUnsetOptionIsNoopForNonOSSource(t *testing.T) {
+	t.Setenv("API_TOKEN", "should-not-be-touched")
+
+	type config struct {
+		Token string `env:"API_TOKEN,required,unset"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{Environment: map[string]string{"API_TOKEN": "from-map"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Token != "from-map" {
+		t.Errorf("Token = %q, want %q", cfg.Token, "from-map")
+	}
+	if v, ok := os.LookupEnv("API_TOKEN"); !ok || v != "should-not-be-touched" {
+		t.Errorf("real process env API_TOKEN was mutated: got (%q, %v)", v, ok)
+	}
+}
+
+func TestAggregateErrorFailFastReturnsFirstError(t *testing.T) {
+	var cfg aggregateConfig
+	err := ParseWithOptions(&cfg, Options{
+		FailFast: true,
+		Environment: map[string]string{
+			"PORT":    "not-a-number",
+			"TIMEOUT": "also-not-a-number",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	var agg *AggregateError
+	if errors.As(err, &agg) {
+		t.Fatalf("expected a plain error with FailFast, got an *AggregateError: %v", err)
+	}
+}
+
+func TestOnSetReceivesFieldValueAndRawString(t *testing.T) {
+	type config struct {
+		Port int `env:"PORT"`
+	}
+
+	type call struct {
+		field reflect.StructField
+		value interface{}
+		raw   string
+	}
+	var calls []call
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		Environment: map[string]string{"PORT": "8080"},
+		OnSet: func(field reflect.StructField, value interface{}, raw string) {
+			calls = append(calls, call{field, value, raw})
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected OnSet to fire once, got %d", len(calls))
+	}
+	if calls[0].field.Name != "Port" {
+		t.Errorf("field.Name = %q, want %q", calls[0].field.Name, "Port")
+	}
+	if calls[0].value != 8080 {
+		t.Errorf("value = %v, want %v", calls[0].value, 8080)
+	}
+	if calls[0].raw != "8080" {
+		t.Errorf("raw = %q, want %q", calls[0].raw, "8080")
+	}
+}
+
+type celsius float64
+
+func (c *celsius) UnmarshalText(_ []byte) error {
+	return errors.New("celsius cannot be parsed directly")
+}
+
+func TestParseWithFuncsUsesCustomParser(t *testing.T) {
+	type config struct {
+		Temp celsius `env:"TEMP"`
+	}
+
+	var cfg config
+	err := ParseWithFuncs(&cfg, CustomParsers{
+		reflect.TypeOf(celsius(0)): func(v string) (interface{}, error) {
+			f, err := strconv.ParseFloat(v, 64)
+			return celsius(f), err
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Temp != celsius(0) {
+		t.Errorf("Temp = %v, want %v (Environment unset, ParseWithFuncs uses process env)", cfg.Temp, celsius(0))
+	}
+
+	t.Setenv("TEMP", "21.5")
+	cfg = config{}
+	if err := ParseWithFuncs(&cfg, CustomParsers{
+		reflect.TypeOf(celsius(0)): func(v string) (interface{}, error) {
+			f, err := strconv.ParseFloat(v, 64)
+			return celsius(f), err
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Temp != celsius(21.5) {
+		t.Errorf("Temp = %v, want %v", cfg.Temp, celsius(21.5))
+	}
+}
+
+func TestRequiredIfNoDefMakesUndefaultedFieldRequired(t *testing.T) {
+	type config struct {
+		Host string `env:"HOST"`
+		Port int    `env:"PORT" envDefault:"8080"`
+	}
+
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		RequiredIfNoDef: true,
+		Environment:     map[string]string{},
+	})
+	if err == nil {
+		t.Fatal("expected an error because HOST has no envDefault and is unset")
+	}
+
+	cfg = config{}
+	err = ParseWithOptions(&cfg, Options{
+		RequiredIfNoDef: true,
+		Environment:     map[string]string{"HOST": "localhost"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Host != "localhost" {
+		t.Errorf("Host = %q, want %q", cfg.Host, "localhost")
+	}
+	if cfg.Port != 8080 {
+		t.Errorf("Port = %d, want %d (has envDefault, so RequiredIfNoDef shouldn't apply)", cfg.Port, 8080)
+	}
+}
@@ -0,0 +1,118 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Source resolves environment-like key/value lookups from an arbitrary
+// backing store. Implementations let ParseWithOptions read from something
+// other than the process environment without any global state.
+type Source interface {
+	Lookup(key string) (string, bool)
+}
+
+// OSSource is a Source that reads from the process environment via
+// os.LookupEnv. It's the implicit source when both Options.Source and
+// Options.Environment are nil.
+type OSSource struct{}
+
+// Lookup implements Source.
+func (OSSource) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// MapSource is a Source backed by an in-memory map, handy for tests and for
+// consumers who already have their configuration as a map[string]string.
+type MapSource map[string]string
+
+// Lookup implements Source.
+func (m MapSource) Lookup(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// LayeredSource queries a list of Sources in order and returns the first
+// hit, so e.g. process env values can take priority over a dotenv file, or
+// vice versa.
+type LayeredSource []Source
+
+// Lookup implements Source.
+func (l LayeredSource) Lookup(key string) (string, bool) {
+	for _, s := range l {
+		if v, ok := s.Lookup(key); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// DotEnvSource is a Source backed by the contents of one or more
+// dotenv-formatted files, parsed eagerly by NewDotEnvSource or MustDotEnv.
+type DotEnvSource map[string]string
+
+// Lookup implements Source.
+func (d DotEnvSource) Lookup(key string) (string, bool) {
+	v, ok := d[key]
+	return v, ok
+}
+
+// NewDotEnvSource reads and parses the given dotenv files, in order, with
+// later files overriding keys set by earlier ones. Each file supports
+// `#`-prefixed comments, blank lines, an optional `export ` prefix, and
+// single- or double-quoted values; double-quoted values additionally
+// recognize `\n` and `\t` escapes.
+func NewDotEnvSource(paths ...string) (DotEnvSource, error) {
+	vars := DotEnvSource{}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("env: could not read dotenv file %q: %w", path, err)
+		}
+		if err := parseDotEnv(string(b), vars); err != nil {
+			return nil, fmt.Errorf("env: could not parse dotenv file %q: %w", path, err)
+		}
+	}
+	return vars, nil
+}
+
+// MustDotEnv is like NewDotEnvSource but panics instead of returning an
+// error, for use while building an Options value at program startup, e.g.
+// Options{Source: LayeredSource{OSSource{}, MustDotEnv(".env")}}.
+func MustDotEnv(paths ...string) DotEnvSource {
+	src, err := NewDotEnvSource(paths...)
+	if err != nil {
+		panic(err)
+	}
+	return src
+}
+
+func parseDotEnv(content string, into DotEnvSource) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return fmt.Errorf("line %d: missing '='", i+1)
+		}
+		key := strings.TrimSpace(line[:eq])
+		into[key] = unquoteDotEnvValue(strings.TrimSpace(line[eq+1:]))
+	}
+	return nil
+}
+
+func unquoteDotEnvValue(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		unescaper := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+		return unescaper.Replace(value[1 : len(value)-1])
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDotEnvSourceParsing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "" +
+		"# a comment\n" +
+		"\n" +
+		"export FOO=bar\n" +
+		"BAZ=\"hello\\nworld\"\n" +
+		"TABBED=\"a\\tb\"\n" +
+		"QUOTE='single quoted'\n" +
+		"PLAIN=unquoted value\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewDotEnvSource(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"FOO", "bar"},
+		{"BAZ", "hello\nworld"},
+		{"TABBED", "a\tb"},
+		{"QUOTE", "single quoted"},
+		{"PLAIN", "unquoted value"},
+	}
+	for _, tt := range tests {
+		got, ok := src.Lookup(tt.key)
+		if !ok {
+			t.Errorf("Lookup(%q) missing", tt.key)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	if _, ok := src.Lookup("NOPE"); ok {
+		t.Error("Lookup(\"NOPE\") found a value that shouldn't exist")
+	}
+}
+
+func TestDotEnvSourceMultipleFilesLaterWins(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.env")
+	override := filepath.Join(dir, "override.env")
+	if err := os.WriteFile(base, []byte("FOO=base\nBAR=base\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte("FOO=override\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewDotEnvSource(base, override)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := src.Lookup("FOO"); v != "override" {
+		t.Errorf("FOO = %q, want %q", v, "override")
+	}
+	if v, _ := src.Lookup("BAR"); v != "base" {
+		t.Errorf("BAR = %q, want %q", v, "base")
+	}
+}
+
+func TestDotEnvSourceMissingEqualsErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("NOT_A_KV_LINE\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDotEnvSource(path); err == nil {
+		t.Fatal("expected an error for a line without '='")
+	}
+}
+
+func TestMustDotEnvPanicsOnMissingFile(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustDotEnv to panic for a missing file")
+		}
+	}()
+	MustDotEnv(filepath.Join(t.TempDir(), "does-not-exist.env"))
+}
+
+func TestLayeredSourceReturnsFirstHit(t *testing.T) {
+	src := LayeredSource{
+		MapSource{"FOO": "from-first"},
+		MapSource{"FOO": "from-second", "BAR": "from-second"},
+	}
+
+	if v, ok := src.Lookup("FOO"); !ok || v != "from-first" {
+		t.Errorf("Lookup(FOO) = (%q, %v), want (%q, true)", v, ok, "from-first")
+	}
+	if v, ok := src.Lookup("BAR"); !ok || v != "from-second" {
+		t.Errorf("Lookup(BAR) = (%q, %v), want (%q, true)", v, ok, "from-second")
+	}
+	if _, ok := src.Lookup("BAZ"); ok {
+		t.Error("Lookup(BAZ) found a value that shouldn't exist in any layer")
+	}
+}
+
+func TestOSSourceReadsProcessEnv(t *testing.T) {
+	t.Setenv("GO_ENV_SOURCE_TEST", "yes")
+	if v, ok := (OSSource{}).Lookup("GO_ENV_SOURCE_TEST"); !ok || v != "yes" {
+		t.Errorf("Lookup = (%q, %v), want (%q, true)", v, ok, "yes")
+	}
+}
+
+func TestParseWithOptionsUsesLayeredSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("HOST=dotenv-host\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type config struct {
+		Host string `env:"HOST"`
+	}
+	var cfg config
+	err := ParseWithOptions(&cfg, Options{
+		Source: LayeredSource{MapSource{}, MustDotEnv(path)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Host != "dotenv-host" {
+		t.Errorf("Host = %q, want %q", cfg.Host, "dotenv-host")
+	}
+}